@@ -0,0 +1,86 @@
+// Copyright 2024 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package perhost
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// PacketDialer is a [transport.PacketDialer] that routes to a different child dialer
+// based on the destination host. It mirrors [StreamDialer]'s rule matching.
+type PacketDialer struct {
+	def   transport.PacketDialer
+	rules rules[transport.PacketDialer]
+}
+
+var _ transport.PacketDialer = (*PacketDialer)(nil)
+
+// NewPacketDialer creates a [PacketDialer] that falls back to def when no rule matches.
+// def may be nil, in which case unmatched hosts fail to dial.
+func NewPacketDialer(def transport.PacketDialer) *PacketDialer {
+	return &PacketDialer{def: def}
+}
+
+// AddHost routes host, matched exactly (case-insensitively), to dialer.
+func (d *PacketDialer) AddHost(host string, dialer transport.PacketDialer) {
+	d.rules.add(hostMatcher(host), dialer)
+}
+
+// AddDomainSuffix routes hosts ending in suffix (e.g. ".example.com") to dialer.
+func (d *PacketDialer) AddDomainSuffix(suffix string, dialer transport.PacketDialer) {
+	d.rules.add(suffixMatcher(suffix), dialer)
+}
+
+// AddCIDR routes IP literal hosts within cidr to dialer.
+func (d *PacketDialer) AddCIDR(cidr string, dialer transport.PacketDialer) error {
+	prefix, err := parsePrefix(cidr)
+	if err != nil {
+		return err
+	}
+	d.rules.add(cidrMatcher{prefix}, dialer)
+	return nil
+}
+
+// AddZone routes IP literal hosts in zone ("loopback", "private", or "linklocal") to
+// dialer.
+func (d *PacketDialer) AddZone(zone string, dialer transport.PacketDialer) error {
+	m, err := newZoneMatcher(zone)
+	if err != nil {
+		return err
+	}
+	d.rules.add(m, dialer)
+	return nil
+}
+
+// DialPacket implements [transport.PacketDialer].DialPacket, routing to the first
+// matching rule's dialer, or the default dialer if no rule matches.
+func (d *PacketDialer) DialPacket(ctx context.Context, addr string) (net.Conn, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, fmt.Errorf("address is not valid host:port: %w", err)
+	}
+	dialer, ok := d.rules.lookup(host)
+	if !ok {
+		dialer = d.def
+	}
+	if dialer == nil {
+		return nil, fmt.Errorf("no dialer configured for host %q", host)
+	}
+	return dialer.DialPacket(ctx, addr)
+}
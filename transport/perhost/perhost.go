@@ -0,0 +1,144 @@
+// Copyright 2024 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package perhost provides dialers that route to a different child dialer depending on
+// the destination host, similar in spirit to [golang.org/x/net/proxy.PerHost] but
+// generalized to an arbitrary number of rules, each with its own child dialer, rather
+// than a single bypass dialer.
+package perhost
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+)
+
+// matcher reports whether a given host (a hostname or an IP literal, as it appears in
+// the address passed to DialStream/DialPacket) satisfies a routing rule.
+type matcher interface {
+	Match(host string) bool
+}
+
+type hostMatcher string
+
+func (m hostMatcher) Match(host string) bool {
+	return strings.EqualFold(host, string(m))
+}
+
+// suffixMatcher matches hosts ending in a DNS suffix, such as ".example.com".
+type suffixMatcher string
+
+func (m suffixMatcher) Match(host string) bool {
+	return strings.HasSuffix(strings.ToLower(host), strings.ToLower(string(m)))
+}
+
+type cidrMatcher struct {
+	prefix netip.Prefix
+}
+
+func (m cidrMatcher) Match(host string) bool {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	return m.prefix.Contains(addr)
+}
+
+// zoneMatcher matches hosts that are IP literals in one of the well-known zones defined
+// by [golang.org/x/net/proxy.PerHost]: "loopback", "private", or "linklocal".
+type zoneMatcher string
+
+func (m zoneMatcher) Match(host string) bool {
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return false
+	}
+	switch string(m) {
+	case "loopback":
+		return addr.IsLoopback()
+	case "linklocal":
+		return addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast()
+	case "private":
+		return isPrivate(addr)
+	default:
+		return false
+	}
+}
+
+// isPrivate reports whether addr is in one of the IPv4 private-use ranges (RFC 1918) or
+// the IPv6 unique local range (RFC 4193).
+func isPrivate(addr netip.Addr) bool {
+	if addr.Is4In6() {
+		addr = addr.Unmap()
+	}
+	if addr.Is4() {
+		b := addr.As4()
+		switch {
+		case b[0] == 10:
+			return true
+		case b[0] == 172 && b[1]&0xf0 == 16:
+			return true
+		case b[0] == 192 && b[1] == 168:
+			return true
+		default:
+			return false
+		}
+	}
+	return addr.As16()[0]&0xfe == 0xfc
+}
+
+// parsePrefix parses cidr into a [netip.Prefix], wrapping the error for context.
+func parsePrefix(cidr string) (netip.Prefix, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid CIDR %q: %w", cidr, err)
+	}
+	return prefix, nil
+}
+
+// newZoneMatcher validates zone and returns a matcher for it.
+func newZoneMatcher(zone string) (matcher, error) {
+	switch zone {
+	case "loopback", "private", "linklocal":
+		return zoneMatcher(zone), nil
+	default:
+		return nil, fmt.Errorf("unknown zone %q, must be one of loopback, private, linklocal", zone)
+	}
+}
+
+// rules is the ordered set of (matcher, value) pairs shared by [StreamDialer] and
+// [PacketDialer]. The first matching rule wins; ties are broken by registration order.
+type rules[T any] struct {
+	entries []ruleEntry[T]
+}
+
+type ruleEntry[T any] struct {
+	matcher matcher
+	value   T
+}
+
+func (r *rules[T]) add(m matcher, v T) {
+	r.entries = append(r.entries, ruleEntry[T]{matcher: m, value: v})
+}
+
+// lookup returns the value of the first rule matching host, and whether one was found.
+func (r *rules[T]) lookup(host string) (T, bool) {
+	for _, e := range r.entries {
+		if e.matcher.Match(host) {
+			return e.value, true
+		}
+	}
+	var zero T
+	return zero, false
+}
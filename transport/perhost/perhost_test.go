@@ -0,0 +1,88 @@
+// Copyright 2024 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package perhost
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+// namedDialer is a [transport.StreamDialer] that records its own name as the returned
+// error, so tests can assert which child dialer a given address was routed to.
+type namedDialer string
+
+func (n namedDialer) DialStream(ctx context.Context, addr string) (transport.StreamConn, error) {
+	return nil, routedTo(n)
+}
+
+type routedTo string
+
+func (r routedTo) Error() string { return string(r) }
+
+func routed(t *testing.T, d transport.StreamDialer, addr string) string {
+	t.Helper()
+	_, err := d.DialStream(context.Background(), addr)
+	require.Error(t, err)
+	return err.Error()
+}
+
+func TestStreamDialerRouting(t *testing.T) {
+	d := NewStreamDialer(namedDialer("default"))
+	d.AddHost("exact.example.com", namedDialer("host"))
+	d.AddDomainSuffix(".internal.example.com", namedDialer("suffix"))
+	require.NoError(t, d.AddCIDR("10.0.0.0/8", namedDialer("cidr")))
+	require.NoError(t, d.AddZone("loopback", namedDialer("loopback")))
+	require.NoError(t, d.AddZone("private", namedDialer("private")))
+
+	cases := []struct {
+		addr string
+		want string
+	}{
+		{"exact.example.com:443", "host"},
+		{"EXACT.EXAMPLE.COM:443", "host"},
+		{"foo.internal.example.com:443", "suffix"},
+		{"internal.example.com:443", "default"},
+		{"10.1.2.3:80", "cidr"},
+		{"127.0.0.1:80", "loopback"},
+		{"192.168.1.1:80", "private"},
+		{"8.8.8.8:53", "default"},
+		{"other.example.com:443", "default"},
+	}
+	for _, c := range cases {
+		require.Equal(t, c.want, routed(t, d, c.addr), "addr=%s", c.addr)
+	}
+}
+
+func TestStreamDialerFirstRuleWins(t *testing.T) {
+	d := NewStreamDialer(namedDialer("default"))
+	require.NoError(t, d.AddCIDR("10.0.0.0/8", namedDialer("first")))
+	require.NoError(t, d.AddCIDR("10.1.0.0/16", namedDialer("second")))
+	require.Equal(t, "first", routed(t, d, "10.1.2.3:80"))
+}
+
+func TestStreamDialerNoDefaultErrors(t *testing.T) {
+	d := NewStreamDialer(nil)
+	_, err := d.DialStream(context.Background(), "example.com:443")
+	require.Error(t, err)
+}
+
+func TestAddZoneRejectsUnknownZone(t *testing.T) {
+	d := NewStreamDialer(nil)
+	err := d.AddZone("bogus", namedDialer("x"))
+	require.Error(t, err)
+}
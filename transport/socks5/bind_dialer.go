@@ -0,0 +1,120 @@
+// Copyright 2024 Jigsaw Operations LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package socks5
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/netip"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// CmdBind is the SOCKS5 BIND command.
+// See https://datatracker.ietf.org/doc/html/rfc1928#section-4.
+const CmdBind = 2
+
+// Bind issues a SOCKS5 BIND request for dstAddr, the address of the peer that is
+// expected to connect to the proxy. It returns a [transport.StreamListener] bound on
+// the proxy, which callers can advertise to dstAddr (e.g. over an existing control
+// channel, as in active-mode FTP) so that it can connect back.
+//
+// See https://datatracker.ietf.org/doc/html/rfc1928#section-4.
+func (d *Dialer) Bind(ctx context.Context, dstAddr string) (transport.StreamListener, error) {
+	ctrlConn, boundAddr, err := d.request(ctx, CmdBind, dstAddr)
+	if err != nil {
+		return nil, fmt.Errorf("BIND request failed: %w", err)
+	}
+	addrPort, err := netip.ParseAddrPort(boundAddr)
+	if err != nil {
+		ctrlConn.Close()
+		return nil, fmt.Errorf("invalid BIND bound address %v: %w", boundAddr, err)
+	}
+	return &bindListener{ctrlConn: ctrlConn, boundAddr: addrPort}, nil
+}
+
+// bindListener is the [transport.StreamListener] returned by [Dialer.Bind]. It holds
+// the single control connection used for both BIND replies defined by RFC 1928 §4: the
+// first, already consumed by [Dialer.request], carries the address the proxy is
+// listening on; the second, read by Accept, carries the address of the peer that
+// connected.
+type bindListener struct {
+	ctrlConn  transport.StreamConn
+	boundAddr netip.AddrPort
+}
+
+var _ transport.StreamListener = (*bindListener)(nil)
+
+// BoundAddr returns the address and port the proxy is listening on, as returned in the
+// first BIND reply. Callers advertise this to the remote peer so it knows where to
+// connect.
+func (l *bindListener) BoundAddr() netip.AddrPort {
+	return l.boundAddr
+}
+
+// Accept blocks until the proxy's second BIND reply arrives, reporting that the remote
+// peer has connected, and returns a [transport.StreamConn] for the proxied stream. It
+// can only be called once: the underlying connection carries a single stream, not a
+// listening socket.
+func (l *bindListener) Accept() (transport.StreamConn, error) {
+	// Second reply (VER, REP, RSV, ATYP, BND.ADDR, BND.PORT).
+	// See https://datatracker.ietf.org/doc/html/rfc1928#section-6.
+	var header [4]byte
+	if _, err := io.ReadFull(l.ctrlConn, header[:]); err != nil {
+		return nil, fmt.Errorf("failed to read second BIND reply: %w", err)
+	}
+	if header[0] != 5 {
+		return nil, fmt.Errorf("invalid protocol version %v. Expected 5", header[0])
+	}
+	if header[1] != 0 {
+		return nil, ReplyCode(header[1])
+	}
+
+	var addrLen int
+	switch header[3] {
+	case addrTypeIPv4:
+		addrLen = 4
+	case addrTypeIPv6:
+		addrLen = 16
+	case addrTypeDomainName:
+		var lenByte [1]byte
+		if _, err := io.ReadFull(l.ctrlConn, lenByte[:]); err != nil {
+			return nil, fmt.Errorf("failed to read address length in second BIND reply: %w", err)
+		}
+		addrLen = int(lenByte[0])
+	default:
+		return nil, fmt.Errorf("invalid address type %v", header[3])
+	}
+	addrAndPort := make([]byte, addrLen+2)
+	if _, err := io.ReadFull(l.ctrlConn, addrAndPort); err != nil {
+		return nil, fmt.Errorf("failed to read peer address in second BIND reply: %w", err)
+	}
+	_ = binary.BigEndian.Uint16(addrAndPort[addrLen:])
+
+	return l.ctrlConn, nil
+}
+
+// Close closes the control connection backing the listener.
+func (l *bindListener) Close() error {
+	return l.ctrlConn.Close()
+}
+
+// Addr returns the address the proxy is listening on.
+func (l *bindListener) Addr() net.Addr {
+	return net.TCPAddrFromAddrPort(l.boundAddr)
+}
@@ -0,0 +1,146 @@
+// Copyright 2024 Jigsaw Operations LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package socks5
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStreamConn adapts a [net.Conn] (such as one half of a [net.Pipe]) to
+// [transport.StreamConn] for use in tests.
+type fakeStreamConn struct {
+	net.Conn
+}
+
+func (c *fakeStreamConn) CloseWrite() error { return nil }
+func (c *fakeStreamConn) CloseRead() error  { return nil }
+
+type funcStreamEndpoint func(ctx context.Context) (transport.StreamConn, error)
+
+func (f funcStreamEndpoint) ConnectStream(ctx context.Context) (transport.StreamConn, error) {
+	return f(ctx)
+}
+
+func newTestDialer(t *testing.T) (*Dialer, net.Conn) {
+	clientSide, serverSide := net.Pipe()
+	t.Cleanup(func() { clientSide.Close(); serverSide.Close() })
+	dialer, err := NewDialer(funcStreamEndpoint(func(ctx context.Context) (transport.StreamConn, error) {
+		return &fakeStreamConn{clientSide}, nil
+	}))
+	require.NoError(t, err)
+	return dialer, serverSide
+}
+
+// readMethodAndCmdRequest drains the merged method-selection and CMD request that
+// [Dialer.request] sends in a single write, returning the requested CMD byte.
+//
+// The whole request must be read off the wire before any reply is written back: since
+// net.Pipe is unbuffered, the client's single merged Write won't return until all of it
+// has been read, so writing the method-selection reply after reading only part of the
+// request would deadlock against the client's still-pending Write. The DST.ADDR can be
+// any ATYP depending on what was dialed (e.g. "example.com:80" encodes as a domain
+// name), so branch on cmdHeader[3] the same way [bindListener.Accept] does rather than
+// assuming a fixed-size IPv4 address.
+func readMethodAndCmdRequest(t *testing.T, server net.Conn) byte {
+	t.Helper()
+	var methodReq [3]byte
+	_, err := io.ReadFull(server, methodReq[:])
+	require.NoError(t, err)
+	require.EqualValues(t, 5, methodReq[0])
+
+	var cmdHeader [4]byte
+	_, err = io.ReadFull(server, cmdHeader[:])
+	require.NoError(t, err)
+	require.EqualValues(t, 5, cmdHeader[0])
+
+	var addrLen int
+	switch cmdHeader[3] {
+	case addrTypeIPv4:
+		addrLen = 4
+	case addrTypeIPv6:
+		addrLen = 16
+	case addrTypeDomainName:
+		var lenByte [1]byte
+		_, err = io.ReadFull(server, lenByte[:])
+		require.NoError(t, err)
+		addrLen = int(lenByte[0])
+	default:
+		t.Fatalf("unexpected address type %v", cmdHeader[3])
+	}
+	addrAndPort := make([]byte, addrLen+2)
+	_, err = io.ReadFull(server, addrAndPort)
+	require.NoError(t, err)
+
+	_, err = server.Write([]byte{5, authMethodNoAuth})
+	require.NoError(t, err)
+
+	return cmdHeader[1]
+}
+
+func writeBindReply(t *testing.T, server net.Conn, rep byte, ip [4]byte, port uint16) {
+	t.Helper()
+	reply := []byte{5, rep, 0, addrTypeIPv4, ip[0], ip[1], ip[2], ip[3], byte(port >> 8), byte(port)}
+	_, err := server.Write(reply)
+	require.NoError(t, err)
+}
+
+func TestBindAccept(t *testing.T) {
+	dialer, server := newTestDialer(t)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cmd := readMethodAndCmdRequest(t, server)
+		require.EqualValues(t, CmdBind, cmd)
+		// First reply: address the proxy is listening on.
+		writeBindReply(t, server, 0, [4]byte{127, 0, 0, 1}, 1080)
+		// Second reply: the peer has connected.
+		writeBindReply(t, server, 0, [4]byte{10, 0, 0, 5}, 9999)
+	}()
+
+	listener, err := dialer.Bind(context.Background(), "example.com:80")
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.1:1080", listener.Addr().String())
+
+	conn, err := listener.Accept()
+	require.NoError(t, err)
+	require.NotNil(t, conn)
+	<-done
+}
+
+func TestBindAcceptSecondReplyError(t *testing.T) {
+	dialer, server := newTestDialer(t)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cmd := readMethodAndCmdRequest(t, server)
+		require.EqualValues(t, CmdBind, cmd)
+		writeBindReply(t, server, 0, [4]byte{127, 0, 0, 1}, 1080)
+		// Second reply reports a failure (e.g. connection refused by the peer).
+		writeBindReply(t, server, byte(ReplyConnectionRefused), [4]byte{0, 0, 0, 0}, 0)
+	}()
+
+	listener, err := dialer.Bind(context.Background(), "example.com:80")
+	require.NoError(t, err)
+
+	_, err = listener.Accept()
+	require.ErrorIs(t, err, ReplyConnectionRefused)
+	<-done
+}
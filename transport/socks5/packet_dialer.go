@@ -0,0 +1,157 @@
+// Copyright 2024 Jigsaw Operations LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package socks5
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// CmdUDPAssociate is the SOCKS5 UDP ASSOCIATE command.
+// See https://datatracker.ietf.org/doc/html/rfc1928#section-4.
+const CmdUDPAssociate = 3
+
+// maxUDPMessageSize is large enough to hold the largest possible UDP datagram plus the
+// SOCKS5 UDP request header (3 + 1 + 1 + 255 + 2 for a full-length domain name DST.ADDR
+// with its length octet).
+const maxUDPMessageSize = 65535 + 3 + 1 + 1 + 255 + 2
+
+// DialPacket implements [transport.PacketDialer].DialPacket using the SOCKS5 UDP
+// ASSOCIATE command. It opens a TCP control connection to the proxy, which must stay
+// open for the life of the association: once it closes, the proxy tears down the relay
+// and the returned [net.Conn] fails all subsequent I/O.
+//
+// See https://datatracker.ietf.org/doc/html/rfc1928#section-7.
+func (d *Dialer) DialPacket(ctx context.Context, addr string) (net.Conn, error) {
+	if d.pd == nil {
+		return nil, errors.New("packet dialer not enabled; call EnablePacket first")
+	}
+	// The UDP ASSOCIATE request's DST.ADDR/DST.PORT is the address the client expects
+	// to send UDP datagrams FROM, not the final traffic destination (that's encoded
+	// per-datagram in Write via appendSOCKS5Address). It must be all-zero here, since
+	// we don't know our local UDP address until d.pd.DialPacket opens it below.
+	// See https://datatracker.ietf.org/doc/html/rfc1928#section-7.
+	ctrlConn, relayAddr, err := d.request(ctx, CmdUDPAssociate, "0.0.0.0:0")
+	if err != nil {
+		return nil, fmt.Errorf("UDP associate request failed: %w", err)
+	}
+	associated := false
+	defer func() {
+		if !associated {
+			ctrlConn.Close()
+		}
+	}()
+
+	udpConn, err := d.pd.DialPacket(ctx, relayAddr)
+	if err != nil {
+		return nil, fmt.Errorf("could not dial SOCKS5 UDP relay at %v: %w", relayAddr, err)
+	}
+
+	pc := &packetConn{Conn: udpConn, ctrlConn: ctrlConn, dstAddr: addr}
+	go pc.watchControlConn()
+	associated = true
+	return pc, nil
+}
+
+// packetConn is a [net.Conn] to a SOCKS5 UDP relay. It adds and strips the SOCKS5 UDP
+// request header on every Write and Read, and ties its lifetime to the control
+// connection that created the association.
+type packetConn struct {
+	net.Conn
+	ctrlConn  transport.StreamConn
+	dstAddr   string
+	closeOnce sync.Once
+}
+
+var _ net.Conn = (*packetConn)(nil)
+
+// watchControlConn blocks on the control connection until it fails or is closed, then
+// closes the packet conn so that subsequent I/O on it also fails. Per RFC 1928 §7, the
+// proxy never sends data on the control connection during normal operation.
+func (c *packetConn) watchControlConn() {
+	var b [1]byte
+	c.ctrlConn.Read(b[:])
+	c.Close()
+}
+
+// Close closes both the UDP relay socket and the control connection that backs it.
+func (c *packetConn) Close() error {
+	var err error
+	c.closeOnce.Do(func() {
+		err = c.Conn.Close()
+		c.ctrlConn.Close()
+	})
+	return err
+}
+
+// Write implements [net.Conn].Write, prepending the SOCKS5 UDP request header
+// (RSV(2)|FRAG(1)|ATYP|DST.ADDR|DST.PORT) to the datagram before sending it to the relay.
+func (c *packetConn) Write(b []byte) (int, error) {
+	header := make([]byte, 3, 3+7+len(b))
+	header, err := appendSOCKS5Address(header, c.dstAddr)
+	if err != nil {
+		return 0, fmt.Errorf("failed to create SOCKS5 UDP address: %w", err)
+	}
+	if _, err := c.Conn.Write(append(header, b...)); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+// Read implements [net.Conn].Read, stripping the SOCKS5 UDP request header from the
+// datagram. Fragmented replies (FRAG != 0) are rejected, as fragmentation is rare in
+// practice and not required by the RFC to be supported.
+func (c *packetConn) Read(b []byte) (int, error) {
+	var buf [maxUDPMessageSize]byte
+	n, err := c.Conn.Read(buf[:])
+	if err != nil {
+		return 0, err
+	}
+	if n < 4 {
+		return 0, errors.New("SOCKS5 UDP datagram shorter than header")
+	}
+	if buf[2] != 0 {
+		return 0, errors.New("fragmented SOCKS5 UDP datagrams are not supported")
+	}
+	offset := 4
+	switch buf[3] {
+	case addrTypeIPv4:
+		offset += 4
+	case addrTypeIPv6:
+		offset += 16
+	case addrTypeDomainName:
+		if n < offset+1 {
+			return 0, errors.New("truncated SOCKS5 UDP datagram address")
+		}
+		offset += 1 + int(buf[offset])
+	default:
+		return 0, fmt.Errorf("invalid address type %v in SOCKS5 UDP datagram", buf[3])
+	}
+	offset += 2 // DST.PORT
+	if n < offset {
+		return 0, errors.New("truncated SOCKS5 UDP datagram")
+	}
+	copied := copy(b, buf[offset:n])
+	if copied < n-offset {
+		return copied, io.ErrShortBuffer
+	}
+	return copied, nil
+}
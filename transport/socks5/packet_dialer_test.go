@@ -0,0 +1,169 @@
+// Copyright 2024 Jigsaw Operations LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package socks5
+
+import (
+	"context"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakePacketDialer is a [transport.PacketDialer] that hands back a fixed [net.Conn] and
+// records the relay address it was asked to dial.
+type fakePacketDialer struct {
+	conn    net.Conn
+	gotAddr string
+}
+
+func (d *fakePacketDialer) DialPacket(ctx context.Context, addr string) (net.Conn, error) {
+	d.gotAddr = addr
+	return d.conn, nil
+}
+
+// readAssociateRequest drains the merged method-selection and UDP ASSOCIATE CMD request,
+// returning the CMD byte and the raw DST.ADDR||DST.PORT bytes (assuming an IPv4 ATYP, as
+// used throughout these tests).
+//
+// The whole request must be read off the wire before any reply is written back: since
+// net.Pipe is unbuffered, the client's single merged Write won't return until all of it
+// has been read, so writing the method-selection reply after reading only part of the
+// request would deadlock against the client's still-pending Write.
+func readAssociateRequest(t *testing.T, server net.Conn) (cmd byte, addrAndPort [6]byte) {
+	t.Helper()
+	var methodReq [3]byte
+	_, err := io.ReadFull(server, methodReq[:])
+	require.NoError(t, err)
+	require.EqualValues(t, 5, methodReq[0])
+
+	var cmdHeader [4]byte
+	_, err = io.ReadFull(server, cmdHeader[:])
+	require.NoError(t, err)
+	require.EqualValues(t, 5, cmdHeader[0])
+	require.EqualValues(t, addrTypeIPv4, cmdHeader[3])
+
+	_, err = io.ReadFull(server, addrAndPort[:])
+	require.NoError(t, err)
+
+	_, err = server.Write([]byte{5, authMethodNoAuth})
+	require.NoError(t, err)
+
+	return cmdHeader[1], addrAndPort
+}
+
+func newTestPacketDialer(t *testing.T) (*Dialer, net.Conn, *fakePacketDialer, net.Conn) {
+	dialer, ctrlServer := newTestDialer(t)
+	udpClient, udpServer := net.Pipe()
+	t.Cleanup(func() { udpClient.Close(); udpServer.Close() })
+	fpd := &fakePacketDialer{conn: udpClient}
+	dialer.EnablePacket(fpd)
+	return dialer, ctrlServer, fpd, udpServer
+}
+
+func TestDialPacketSendsZeroAddressInAssociateRequest(t *testing.T) {
+	dialer, ctrlServer, fpd, _ := newTestPacketDialer(t)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		cmd, addrAndPort := readAssociateRequest(t, ctrlServer)
+		require.EqualValues(t, CmdUDPAssociate, cmd)
+		require.Equal(t, [6]byte{0, 0, 0, 0, 0, 0}, addrAndPort)
+		writeBindReply(t, ctrlServer, 0, [4]byte{127, 0, 0, 1}, 1080)
+	}()
+
+	_, err := dialer.DialPacket(context.Background(), "192.0.2.9:9999")
+	require.NoError(t, err)
+	require.Equal(t, "127.0.0.1:1080", fpd.gotAddr)
+	<-done
+}
+
+func TestPacketConnWriteAddsHeaderAndReadStripsIt(t *testing.T) {
+	dialer, ctrlServer, _, udpServer := newTestPacketDialer(t)
+	go func() {
+		readAssociateRequest(t, ctrlServer)
+		writeBindReply(t, ctrlServer, 0, [4]byte{127, 0, 0, 1}, 1080)
+	}()
+
+	conn, err := dialer.DialPacket(context.Background(), "192.0.2.9:9999")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	relayDone := make(chan []byte, 1)
+	go func() {
+		buf := make([]byte, 1500)
+		n, err := udpServer.Read(buf)
+		require.NoError(t, err)
+		relayDone <- buf[:n]
+	}()
+
+	_, err = conn.Write([]byte("hello"))
+	require.NoError(t, err)
+	datagram := <-relayDone
+	// RSV(2)=0, FRAG(1)=0, ATYP=1, DST.ADDR=192.0.2.9, DST.PORT=9999, DATA.
+	require.Equal(t, []byte{0, 0, 0, 1, 192, 0, 2, 9, 0x27, 0x0F}, datagram[:10])
+	require.Equal(t, "hello", string(datagram[10:]))
+
+	reply := append([]byte{0, 0, 0, 1, 192, 0, 2, 9, 0x27, 0x0F}, []byte("world")...)
+	go func() {
+		_, err := udpServer.Write(reply)
+		require.NoError(t, err)
+	}()
+	buf := make([]byte, 1500)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	require.Equal(t, "world", string(buf[:n]))
+}
+
+func TestPacketConnRejectsFragmentedReply(t *testing.T) {
+	dialer, ctrlServer, _, udpServer := newTestPacketDialer(t)
+	go func() {
+		readAssociateRequest(t, ctrlServer)
+		writeBindReply(t, ctrlServer, 0, [4]byte{127, 0, 0, 1}, 1080)
+	}()
+
+	conn, err := dialer.DialPacket(context.Background(), "192.0.2.9:9999")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	fragmented := []byte{0, 0, 1, 1, 192, 0, 2, 9, 0x27, 0x0F, 'h', 'i'}
+	go func() {
+		_, err := udpServer.Write(fragmented)
+		require.NoError(t, err)
+	}()
+	buf := make([]byte, 1500)
+	_, err = conn.Read(buf)
+	require.Error(t, err)
+}
+
+func TestPacketConnClosesWhenControlConnCloses(t *testing.T) {
+	dialer, ctrlServer, _, _ := newTestPacketDialer(t)
+	go func() {
+		readAssociateRequest(t, ctrlServer)
+		writeBindReply(t, ctrlServer, 0, [4]byte{127, 0, 0, 1}, 1080)
+	}()
+
+	conn, err := dialer.DialPacket(context.Background(), "192.0.2.9:9999")
+	require.NoError(t, err)
+
+	ctrlServer.Close()
+
+	require.Eventually(t, func() bool {
+		_, err := conn.Write([]byte("x"))
+		return err != nil
+	}, time.Second, 10*time.Millisecond)
+}
@@ -0,0 +1,34 @@
+// Copyright 2024 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tls
+
+import "context"
+
+// sniContextKey is the context key for a caller-specified TLS ServerName override.
+type sniContextKey struct{}
+
+// WithSNI returns a copy of ctx that carries serverName as a TLS ServerName override.
+// The stream dialer returned by this package's NewStreamDialer uses it, when present,
+// in place of the dial address's host for the ClientHello, letting callers separate the
+// TCP-level Host from the TLS SNI (e.g. for domain-fronting-style setups).
+func WithSNI(ctx context.Context, serverName string) context.Context {
+	return context.WithValue(ctx, sniContextKey{}, serverName)
+}
+
+// SNIFromContext returns the ServerName override attached by [WithSNI], if any.
+func SNIFromContext(ctx context.Context) (string, bool) {
+	name, ok := ctx.Value(sniContextKey{}).(string)
+	return name, ok
+}
@@ -0,0 +1,83 @@
+// Copyright 2024 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package tls provides a [transport.StreamDialer] that wraps a base dialer with TLS.
+package tls
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"net"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// NewStreamDialer creates a [transport.StreamDialer] that establishes a TLS session
+// over a stream from base. config is used as a template for every dial; it may be nil.
+//
+// The ClientHello's ServerName defaults to the dial address's host, but can be
+// overridden per-dial via [WithSNI] — letting a wrapping dialer (such as override:'s
+// sni= option) send a ClientHello for a different name than the address it connects to.
+func NewStreamDialer(base transport.StreamDialer, config *tls.Config) (transport.StreamDialer, error) {
+	if base == nil {
+		return nil, errors.New("base dialer must not be nil")
+	}
+	return transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
+		host, _, err := net.SplitHostPort(addr)
+		if err != nil {
+			return nil, fmt.Errorf("address is not valid host:port: %w", err)
+		}
+
+		conn, err := base.DialStream(ctx, addr)
+		if err != nil {
+			return nil, err
+		}
+
+		cfg := config.Clone()
+		if cfg == nil {
+			cfg = &tls.Config{}
+		}
+		cfg.ServerName = host
+		if sni, ok := SNIFromContext(ctx); ok {
+			cfg.ServerName = sni
+		}
+
+		tlsConn := tls.Client(conn, cfg)
+		if err := tlsConn.HandshakeContext(ctx); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("TLS handshake with %v failed: %w", addr, err)
+		}
+		return &streamConn{Conn: tlsConn, underlying: conn}, nil
+	}), nil
+}
+
+// streamConn adapts a [*tls.Conn] to [transport.StreamConn]. CloseRead and CloseWrite
+// are delegated to the underlying connection, since TLS itself has no notion of
+// half-close.
+type streamConn struct {
+	*tls.Conn
+	underlying transport.StreamConn
+}
+
+var _ transport.StreamConn = (*streamConn)(nil)
+
+func (c *streamConn) CloseRead() error {
+	return c.underlying.CloseRead()
+}
+
+func (c *streamConn) CloseWrite() error {
+	return c.underlying.CloseWrite()
+}
@@ -0,0 +1,132 @@
+// Copyright 2024 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package tls
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeStreamConn adapts a [net.Conn] (such as one half of a [net.Pipe]) to
+// [transport.StreamConn] for use in tests.
+type fakeStreamConn struct {
+	net.Conn
+}
+
+func (c *fakeStreamConn) CloseRead() error  { return nil }
+func (c *fakeStreamConn) CloseWrite() error { return nil }
+
+// generateSelfSignedCert builds a self-signed certificate for dnsName, valid for the
+// duration of a test.
+func generateSelfSignedCert(t *testing.T, dnsName string) tls.Certificate {
+	t.Helper()
+	priv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: dnsName},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		DNSNames:              []string{dnsName},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &priv.PublicKey, priv)
+	require.NoError(t, err)
+	leaf, err := x509.ParseCertificate(der)
+	require.NoError(t, err)
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: priv, Leaf: leaf}
+}
+
+// runHandshake starts a TLS server on one half of a net.Pipe with the given certificate,
+// recording the ServerName the client asked for, and returns the client dialer result.
+func runHandshake(t *testing.T, cert tls.Certificate, clientConfig *tls.Config, ctx context.Context, dialAddr string) (transport.StreamConn, string, error) {
+	t.Helper()
+	clientSide, serverSide := net.Pipe()
+	t.Cleanup(func() { clientSide.Close(); serverSide.Close() })
+
+	var gotServerName string
+	serverErrCh := make(chan error, 1)
+	go func() {
+		tlsServer := tls.Server(serverSide, &tls.Config{
+			GetCertificate: func(hello *tls.ClientHelloInfo) (*tls.Certificate, error) {
+				gotServerName = hello.ServerName
+				return &cert, nil
+			},
+		})
+		serverErrCh <- tlsServer.Handshake()
+	}()
+
+	base := transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
+		return &fakeStreamConn{clientSide}, nil
+	})
+	dialer, err := NewStreamDialer(base, clientConfig)
+	require.NoError(t, err)
+
+	conn, dialErr := dialer.DialStream(ctx, dialAddr)
+	serverErr := <-serverErrCh
+	if dialErr == nil {
+		require.NoError(t, serverErr)
+	}
+	return conn, gotServerName, dialErr
+}
+
+func TestStreamDialerDefaultsSNIToAddressHost(t *testing.T) {
+	cert := generateSelfSignedCert(t, "cdn.example.com")
+	pool := x509.NewCertPool()
+	pool.AddCert(cert.Leaf)
+
+	conn, gotServerName, err := runHandshake(t, cert, &tls.Config{RootCAs: pool}, context.Background(), "cdn.example.com:443")
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Equal(t, "cdn.example.com", gotServerName)
+}
+
+func TestStreamDialerUsesSNIOverride(t *testing.T) {
+	cert := generateSelfSignedCert(t, "real.example.com")
+	pool := x509.NewCertPool()
+	pool.AddCert(cert.Leaf)
+
+	ctx := WithSNI(context.Background(), "real.example.com")
+	conn, gotServerName, err := runHandshake(t, cert, &tls.Config{RootCAs: pool}, ctx, "cdn.example.com:443")
+	require.NoError(t, err)
+	defer conn.Close()
+	require.Equal(t, "real.example.com", gotServerName)
+}
+
+func TestStreamDialerFailsWhenServerNameDoesNotMatchCert(t *testing.T) {
+	cert := generateSelfSignedCert(t, "real.example.com")
+	pool := x509.NewCertPool()
+	pool.AddCert(cert.Leaf)
+
+	// No SNI override: the ClientHello (and certificate verification) uses the dial
+	// address's host, which doesn't match the certificate's DNS name.
+	_, _, err := runHandshake(t, cert, &tls.Config{RootCAs: pool}, context.Background(), "cdn.example.com:443")
+	require.Error(t, err)
+}
@@ -17,29 +17,41 @@ package configurl
 import (
 	"context"
 	"fmt"
+	"io"
 	"net"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/transport/tls"
 )
 
+// happyEyeballsDelay is the stagger between successive connection attempts when
+// resolve yields more than one address and happy_eyeballs is enabled.
+// See https://datatracker.ietf.org/doc/html/rfc8305#section-8.
+const happyEyeballsDelay = 250 * time.Millisecond
+
+// defaultResolveTTL is how long a resolved address is cached when resolve_ttl isn't set.
+const defaultResolveTTL = time.Minute
+
 func registerOverrideStreamDialer(r TypeRegistry[transport.StreamDialer], typeID string, newSD BuildFunc[transport.StreamDialer]) {
 	r.RegisterType(typeID, func(ctx context.Context, config *Config) (transport.StreamDialer, error) {
 		sd, err := newSD(ctx, config.BaseConfig)
 		if err != nil {
 			return nil, err
 		}
-		override, err := newOverrideFromURL(config.URL)
+		opts, err := newOverrideOptions(config.URL)
 		if err != nil {
 			return nil, err
 		}
 		return transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
-			addr, err := override(addr)
+			ctx, addrs, err := opts.resolve(ctx, addr)
 			if err != nil {
 				return nil, err
 			}
-			return sd.DialStream(ctx, addr)
+			return dialFirst(ctx, addrs, sd.DialStream)
 		}), nil
 	})
 }
@@ -50,58 +62,188 @@ func registerOverridePacketDialer(r TypeRegistry[transport.PacketDialer], typeID
 		if err != nil {
 			return nil, err
 		}
-		override, err := newOverrideFromURL(config.URL)
+		opts, err := newOverrideOptions(config.URL)
 		if err != nil {
 			return nil, err
 		}
 		return transport.FuncPacketDialer(func(ctx context.Context, addr string) (net.Conn, error) {
-			addr, err := override(addr)
+			ctx, addrs, err := opts.resolve(ctx, addr)
 			if err != nil {
 				return nil, err
 			}
-			return pd.DialPacket(ctx, addr)
+			return dialFirst(ctx, addrs, pd.DialPacket)
 		}), nil
 	})
 }
 
-func newOverrideFromURL(configURL url.URL) (func(string) (string, error), error) {
-	query := configURL.Opaque
-	values, err := url.ParseQuery(query)
+// overrideOptions holds the parsed options for the override: dialer. In addition to the
+// original host/port override, it supports pre-resolving the address through a
+// configurable resolver, attaching an SNI override for a wrapping TLS dialer, and
+// Happy Eyeballs style racing across resolved addresses.
+type overrideOptions struct {
+	hostOverride  string
+	portOverride  string
+	sni           string
+	resolver      resolver
+	resolveTTL    time.Duration
+	happyEyeballs bool
+	cache         *resolveCache
+}
+
+func newOverrideOptions(configURL url.URL) (*overrideOptions, error) {
+	values, err := url.ParseQuery(configURL.Opaque)
 	if err != nil {
 		return nil, err
 	}
-	hostOverride, portOverride := "", ""
-	for key, values := range values {
+	opts := &overrideOptions{resolveTTL: defaultResolveTTL}
+	var resolveSpec string
+	for key, vs := range values {
+		if len(vs) != 1 {
+			return nil, fmt.Errorf("%v option must have one value, found %v", key, len(vs))
+		}
+		value := vs[0]
 		switch strings.ToLower(key) {
 		case "host":
-			if len(values) != 1 {
-				return nil, fmt.Errorf("host option must has one value, found %v", len(values))
-			}
-			hostOverride = values[0]
+			opts.hostOverride = value
 		case "port":
-			if len(values) != 1 {
-				return nil, fmt.Errorf("port option must has one value, found %v", len(values))
+			opts.portOverride = value
+		case "resolve":
+			resolveSpec = value
+		case "resolve_ttl":
+			opts.resolveTTL, err = time.ParseDuration(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid resolve_ttl %q: %w", value, err)
+			}
+		case "sni":
+			opts.sni = value
+		case "happy_eyeballs":
+			opts.happyEyeballs, err = strconv.ParseBool(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid happy_eyeballs %q: %w", value, err)
 			}
-			portOverride = values[0]
 		default:
 			return nil, fmt.Errorf("unsupported option %v", key)
 		}
 	}
-	return func(address string) (string, error) {
-		// Optimization when we fully override the address.
-		if hostOverride != "" && portOverride != "" {
-			return net.JoinHostPort(hostOverride, portOverride), nil
+	if resolveSpec != "" {
+		opts.resolver, err = newResolver(resolveSpec)
+		if err != nil {
+			return nil, fmt.Errorf("invalid resolve option: %w", err)
 		}
-		host, port, err := net.SplitHostPort(address)
+		opts.cache = newResolveCache(opts.resolveTTL)
+	}
+	return opts, nil
+}
+
+// resolve applies the host/port override and, if configured, pre-resolution and SNI
+// override to address, returning the (possibly several, if Happy Eyeballs is on)
+// addresses to try, in the order they should be attempted, and a context carrying the
+// SNI override for a wrapping TLS dialer to pick up.
+func (o *overrideOptions) resolve(ctx context.Context, address string) (context.Context, []string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return ctx, nil, fmt.Errorf("address is not valid host:port: %w", err)
+	}
+	if o.hostOverride != "" {
+		host = o.hostOverride
+	}
+	if o.portOverride != "" {
+		port = o.portOverride
+	}
+	if o.sni != "" {
+		ctx = tls.WithSNI(ctx, o.sni)
+	}
+	if o.resolver == nil {
+		return ctx, []string{net.JoinHostPort(host, port)}, nil
+	}
+
+	addrs, ok := o.cache.get(host)
+	if !ok {
+		addrs, err = o.resolver.Resolve(ctx, host)
 		if err != nil {
-			return "", fmt.Errorf("address is not valid host:port: %w", err)
+			return ctx, nil, fmt.Errorf("failed to resolve %v: %w", host, err)
 		}
-		if hostOverride != "" {
-			host = hostOverride
+		if len(addrs) == 0 {
+			return ctx, nil, fmt.Errorf("resolver returned no addresses for %v", host)
 		}
-		if portOverride != "" {
-			port = portOverride
+		o.cache.set(host, addrs)
+	}
+
+	if !o.happyEyeballs {
+		return ctx, []string{net.JoinHostPort(addrs[0].String(), port)}, nil
+	}
+	addrs = interleaveAddrs(addrs)
+	addrStrs := make([]string, len(addrs))
+	for i, a := range addrs {
+		addrStrs[i] = net.JoinHostPort(a.String(), port)
+	}
+	return ctx, addrStrs, nil
+}
+
+// dialResult is the outcome of a single dial attempt in [dialFirst].
+type dialResult[C any] struct {
+	conn C
+	err  error
+}
+
+// dialFirst dials addrs in order using dial, staggering later attempts by
+// [happyEyeballsDelay] as in RFC 8305 §5, and returns the first connection to succeed.
+// The remaining attempts are canceled via ctx. With a single address it just dials it.
+func dialFirst[C any](ctx context.Context, addrs []string, dial func(context.Context, string) (C, error)) (C, error) {
+	var zero C
+	if len(addrs) == 1 {
+		return dial(ctx, addrs[0])
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	resultCh := make(chan dialResult[C], len(addrs))
+	for i, addr := range addrs {
+		i, addr := i, addr
+		go func() {
+			if i > 0 {
+				timer := time.NewTimer(time.Duration(i) * happyEyeballsDelay)
+				defer timer.Stop()
+				select {
+				case <-timer.C:
+				case <-ctx.Done():
+					resultCh <- dialResult[C]{zero, ctx.Err()}
+					return
+				}
+			}
+			conn, err := dial(ctx, addr)
+			resultCh <- dialResult[C]{conn, err}
+		}()
+	}
+
+	var firstErr error
+	for i := range addrs {
+		res := <-resultCh
+		if res.err == nil {
+			cancel()
+			// Cancellation can't retroactively undo dials that already succeeded, so
+			// drain the remaining results in the background and close any other
+			// winners, or they'd leak a socket for the lifetime of the process.
+			go drainAndClose(resultCh, len(addrs)-i-1)
+			return res.conn, nil
+		}
+		if firstErr == nil {
+			firstErr = res.err
+		}
+	}
+	return zero, firstErr
+}
+
+// drainAndClose reads the remaining n results off resultCh, closing any successful
+// connections that arrive after the winner has already been returned.
+func drainAndClose[C any](resultCh <-chan dialResult[C], n int) {
+	for i := 0; i < n; i++ {
+		res := <-resultCh
+		if res.err == nil {
+			if closer, ok := any(res.conn).(io.Closer); ok {
+				closer.Close()
+			}
 		}
-		return net.JoinHostPort(host, port), nil
-	}, nil
+	}
 }
@@ -0,0 +1,214 @@
+// Copyright 2024 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configurl
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"sync"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// resolver resolves host to its IP addresses for the override: dialer's resolve option.
+type resolver interface {
+	Resolve(ctx context.Context, host string) ([]netip.Addr, error)
+}
+
+// newResolver builds the [resolver] named by spec, one of:
+//
+//	system               the system's default resolver
+//	udp://host:port      plain DNS over UDP against the given server
+//	https://...          DNS over HTTPS (RFC 8484) against the given URL
+func newResolver(spec string) (resolver, error) {
+	if spec == "system" {
+		return systemResolver{}, nil
+	}
+	u, err := url.Parse(spec)
+	if err != nil {
+		return nil, fmt.Errorf("invalid resolver %q: %w", spec, err)
+	}
+	switch u.Scheme {
+	case "udp":
+		if u.Host == "" {
+			return nil, fmt.Errorf("udp resolver %q is missing a host:port", spec)
+		}
+		return newUDPResolver(u.Host), nil
+	case "https":
+		return &dohResolver{endpoint: spec, client: http.DefaultClient}, nil
+	default:
+		return nil, fmt.Errorf("unsupported resolver %q, must be system, udp://host:port, or an https:// URL", spec)
+	}
+}
+
+// systemResolver resolves using the Go runtime's default resolver.
+type systemResolver struct{}
+
+func (systemResolver) Resolve(ctx context.Context, host string) ([]netip.Addr, error) {
+	return net.DefaultResolver.LookupNetIP(ctx, "ip", host)
+}
+
+// udpResolver resolves using plain DNS over UDP against a fixed server.
+type udpResolver struct {
+	r *net.Resolver
+}
+
+func newUDPResolver(serverAddr string) resolver {
+	return udpResolver{r: &net.Resolver{
+		PreferGo: true,
+		Dial: func(ctx context.Context, network, address string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "udp", serverAddr)
+		},
+	}}
+}
+
+func (r udpResolver) Resolve(ctx context.Context, host string) ([]netip.Addr, error) {
+	return r.r.LookupNetIP(ctx, "ip", host)
+}
+
+// dohResolver resolves using DNS over HTTPS (RFC 8484), POSTing a DNS wire-format query
+// to endpoint.
+type dohResolver struct {
+	endpoint string
+	client   *http.Client
+}
+
+func (r *dohResolver) Resolve(ctx context.Context, host string) ([]netip.Addr, error) {
+	name, err := dnsmessage.NewName(host + ".")
+	if err != nil {
+		return nil, fmt.Errorf("invalid hostname %q: %w", host, err)
+	}
+	var addrs []netip.Addr
+	for _, qType := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		got, err := r.query(ctx, name, qType)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, got...)
+	}
+	return addrs, nil
+}
+
+func (r *dohResolver) query(ctx context.Context, name dnsmessage.Name, qType dnsmessage.Type) ([]netip.Addr, error) {
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{RecursionDesired: true},
+		Questions: []dnsmessage.Question{{
+			Name:  name,
+			Type:  qType,
+			Class: dnsmessage.ClassINET,
+		}},
+	}
+	packed, err := msg.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("failed to build DoH query: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.endpoint, bytes.NewReader(packed))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create DoH request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/dns-message")
+	req.Header.Set("Accept", "application/dns-message")
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("DoH request to %v failed: %w", r.endpoint, err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read DoH response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("DoH server %v returned status %v", r.endpoint, resp.StatusCode)
+	}
+	var respMsg dnsmessage.Message
+	if err := respMsg.Unpack(body); err != nil {
+		return nil, fmt.Errorf("failed to parse DoH response: %w", err)
+	}
+	var addrs []netip.Addr
+	for _, a := range respMsg.Answers {
+		switch body := a.Body.(type) {
+		case *dnsmessage.AResource:
+			addrs = append(addrs, netip.AddrFrom4(body.A))
+		case *dnsmessage.AAAAResource:
+			addrs = append(addrs, netip.AddrFrom16(body.AAAA))
+		}
+	}
+	return addrs, nil
+}
+
+// interleaveAddrs orders addrs alternating IPv6 and IPv4, per the Happy Eyeballs
+// connection-attempt ordering in RFC 8305 §4.
+func interleaveAddrs(addrs []netip.Addr) []netip.Addr {
+	var v4, v6 []netip.Addr
+	for _, a := range addrs {
+		if a.Is4() || a.Is4In6() {
+			v4 = append(v4, a)
+		} else {
+			v6 = append(v6, a)
+		}
+	}
+	out := make([]netip.Addr, 0, len(addrs))
+	for i := 0; i < len(v4) || i < len(v6); i++ {
+		if i < len(v6) {
+			out = append(out, v6[i])
+		}
+		if i < len(v4) {
+			out = append(out, v4[i])
+		}
+	}
+	return out
+}
+
+// resolveCache caches resolved addresses per host for a configurable TTL, so that
+// repeated dials to the same host don't re-resolve on every connection.
+type resolveCache struct {
+	ttl time.Duration
+
+	mu      sync.Mutex
+	entries map[string]resolveCacheEntry
+}
+
+type resolveCacheEntry struct {
+	addrs   []netip.Addr
+	expires time.Time
+}
+
+func newResolveCache(ttl time.Duration) *resolveCache {
+	return &resolveCache{ttl: ttl, entries: make(map[string]resolveCacheEntry)}
+}
+
+func (c *resolveCache) get(host string) ([]netip.Addr, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[host]
+	if !ok || time.Now().After(entry.expires) {
+		return nil, false
+	}
+	return entry.addrs, true
+}
+
+func (c *resolveCache) set(host string, addrs []netip.Addr) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.entries[host] = resolveCacheEntry{addrs: addrs, expires: time.Now().Add(c.ttl)}
+}
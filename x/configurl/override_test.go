@@ -0,0 +1,175 @@
+// Copyright 2024 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configurl
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport/tls"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeResolver returns a fixed set of addresses and counts how many times it was asked.
+type fakeResolver struct {
+	addrs []netip.Addr
+	calls int
+}
+
+func (r *fakeResolver) Resolve(ctx context.Context, host string) ([]netip.Addr, error) {
+	r.calls++
+	return r.addrs, nil
+}
+
+func TestNewOverrideOptionsParsesResolve(t *testing.T) {
+	opts, err := newOverrideOptions(url.URL{Opaque: "resolve=system"})
+	require.NoError(t, err)
+	require.IsType(t, systemResolver{}, opts.resolver)
+
+	opts, err = newOverrideOptions(url.URL{Opaque: "resolve=udp://1.1.1.1:53"})
+	require.NoError(t, err)
+	require.IsType(t, udpResolver{}, opts.resolver)
+
+	_, err = newOverrideOptions(url.URL{Opaque: "resolve=ftp://nope"})
+	require.Error(t, err)
+}
+
+func TestOverrideResolveUsesInjectedResolverAndCaches(t *testing.T) {
+	fake := &fakeResolver{addrs: []netip.Addr{netip.MustParseAddr("192.0.2.1")}}
+	opts := &overrideOptions{resolver: fake, cache: newResolveCache(time.Minute)}
+
+	_, addrs, err := opts.resolve(context.Background(), "example.com:443")
+	require.NoError(t, err)
+	require.Equal(t, []string{"192.0.2.1:443"}, addrs)
+	require.Equal(t, 1, fake.calls)
+
+	// Second dial to the same host should hit the cache, not the resolver.
+	_, addrs, err = opts.resolve(context.Background(), "example.com:443")
+	require.NoError(t, err)
+	require.Equal(t, []string{"192.0.2.1:443"}, addrs)
+	require.Equal(t, 1, fake.calls)
+}
+
+func TestOverrideResolveExpiresCacheEntry(t *testing.T) {
+	fake := &fakeResolver{addrs: []netip.Addr{netip.MustParseAddr("192.0.2.1")}}
+	opts := &overrideOptions{resolver: fake, cache: newResolveCache(-time.Second)}
+
+	_, _, err := opts.resolve(context.Background(), "example.com:443")
+	require.NoError(t, err)
+	_, _, err = opts.resolve(context.Background(), "example.com:443")
+	require.NoError(t, err)
+	require.Equal(t, 2, fake.calls)
+}
+
+func TestOverrideResolveHappyEyeballsInterleaves(t *testing.T) {
+	fake := &fakeResolver{addrs: []netip.Addr{
+		netip.MustParseAddr("192.0.2.1"),
+		netip.MustParseAddr("2001:db8::1"),
+		netip.MustParseAddr("192.0.2.2"),
+	}}
+	opts := &overrideOptions{resolver: fake, cache: newResolveCache(time.Minute), happyEyeballs: true}
+
+	_, addrs, err := opts.resolve(context.Background(), "example.com:443")
+	require.NoError(t, err)
+	require.Equal(t, []string{"[2001:db8::1]:443", "192.0.2.1:443", "192.0.2.2:443"}, addrs)
+}
+
+func TestOverrideResolvePropagatesSNI(t *testing.T) {
+	opts := &overrideOptions{sni: "real.example.com"}
+	ctx, addrs, err := opts.resolve(context.Background(), "cdn.example.com:443")
+	require.NoError(t, err)
+	require.Equal(t, []string{"cdn.example.com:443"}, addrs)
+
+	sni, ok := tls.SNIFromContext(ctx)
+	require.True(t, ok)
+	require.Equal(t, "real.example.com", sni)
+}
+
+func TestOverrideResolveAppliesHostAndPortOverride(t *testing.T) {
+	opts := &overrideOptions{hostOverride: "1.2.3.4", portOverride: "8080"}
+	_, addrs, err := opts.resolve(context.Background(), "example.com:443")
+	require.NoError(t, err)
+	require.Equal(t, []string{"1.2.3.4:8080"}, addrs)
+}
+
+func TestDialFirstSingleAddrDialsDirectly(t *testing.T) {
+	called := false
+	conn, err := dialFirst(context.Background(), []string{"a:1"}, func(ctx context.Context, addr string) (string, error) {
+		called = true
+		return addr, nil
+	})
+	require.NoError(t, err)
+	require.True(t, called)
+	require.Equal(t, "a:1", conn)
+}
+
+func TestDialFirstReturnsFirstSuccess(t *testing.T) {
+	conn, err := dialFirst(context.Background(), []string{"bad:1", "good:2"}, func(ctx context.Context, addr string) (string, error) {
+		if addr == "bad:1" {
+			return "", errors.New("boom")
+		}
+		return addr, nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, "good:2", conn)
+}
+
+func TestDialFirstAllFailReturnsError(t *testing.T) {
+	_, err := dialFirst(context.Background(), []string{"bad:1", "worse:2"}, func(ctx context.Context, addr string) (string, error) {
+		return "", errors.New(addr)
+	})
+	require.Error(t, err)
+}
+
+// fakeCloseableConn is a minimal [io.Closer] used to confirm that [dialFirst] closes
+// surplus successful connections instead of leaking them.
+type fakeCloseableConn struct {
+	addr   string
+	closed bool
+}
+
+func (c *fakeCloseableConn) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestDialFirstClosesSurplusSuccessfulConns(t *testing.T) {
+	gated := &fakeCloseableConn{addr: "slow:1"}
+	fast := &fakeCloseableConn{addr: "fast:2"}
+	// release gates gated's dial so it only succeeds after dialFirst has already
+	// returned fast's connection, regardless of the happyEyeballsDelay stagger or how
+	// quickly cancellation propagates to the other in-flight attempt.
+	release := make(chan struct{})
+
+	conn, err := dialFirst(context.Background(), []string{gated.addr, fast.addr}, func(ctx context.Context, addr string) (*fakeCloseableConn, error) {
+		if addr == gated.addr {
+			<-release
+			return gated, nil
+		}
+		return fast, nil
+	})
+	require.NoError(t, err)
+	require.Same(t, fast, conn)
+
+	close(release)
+	require.Eventually(t, func() bool {
+		return gated.closed
+	}, time.Second, 10*time.Millisecond)
+	require.False(t, fast.closed)
+}
@@ -0,0 +1,182 @@
+// Copyright 2024 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configurl
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/transport/perhost"
+)
+
+// perhostRule is one parsed "rule" option: a set of match specs and the config URL of
+// the dialer they should route to.
+type perhostRule struct {
+	specs     []string
+	dialerURL string
+}
+
+// parsePerHostQuery parses the opaque part of a perhost: config URL into the default
+// dialer's config URL and the list of rules.
+//
+// Grammar (each "&"-separated option):
+//
+//	default=<dialer-config-url>
+//	rule=<matchspec>[;<matchspec>...]-><dialer-config-url>
+//
+// where <matchspec> is one of:
+//
+//	host:<hostname>                     exact hostname match
+//	suffix:<.domain-suffix>              DNS suffix match
+//	cidr:<cidr>                          IPv4/IPv6 CIDR match
+//	zone:<loopback|private|linklocal>    well-known IP zone match
+//
+// "rule" may be repeated, and a single rule may list several match specs, so that
+// multiple match kinds can route to the same child dialer. Rules are tried in the order
+// they appear; the first match wins.
+//
+// Nested dialer config URLs are percent-decoded like any other option value, so a
+// literal "&" belonging to a nested URL (e.g. override:host=evil&port=443) MUST be
+// percent-encoded as "%26" to survive the outer "&"-splitting — otherwise it would be
+// mistaken for the boundary between perhost's own options. A literal "=" needs no such
+// escaping, since only the first "=" in each option is treated as the key/value
+// separator. We parse this by hand, splitting only on the top-level "&" and "="
+// delimiters ourselves, rather than with [url.ParseQuery]: that function also rejects
+// any query containing an unescaped ";", which our own matchspec-list separator uses
+// freely once it's part of a decoded option value.
+func parsePerHostQuery(rawQuery string) (defaultURL string, rules []perhostRule, err error) {
+	for rawQuery != "" {
+		var pair string
+		pair, rawQuery, _ = strings.Cut(rawQuery, "&")
+		if pair == "" {
+			continue
+		}
+		rawKey, rawValue, ok := strings.Cut(pair, "=")
+		if !ok {
+			return "", nil, fmt.Errorf("invalid option %q, must be of the form key=value", pair)
+		}
+		key, err := url.QueryUnescape(rawKey)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid option name %q: %w", rawKey, err)
+		}
+		value, err := url.QueryUnescape(rawValue)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid value for option %q: %w", key, err)
+		}
+		switch strings.ToLower(key) {
+		case "default":
+			if defaultURL != "" {
+				return "", nil, fmt.Errorf("default option must appear exactly once")
+			}
+			defaultURL = value
+		case "rule":
+			specsAndURL := strings.SplitN(value, "->", 2)
+			if len(specsAndURL) != 2 {
+				return "", nil, fmt.Errorf("rule %q must be of the form <matchspec>[;<matchspec>...]-><dialer-url>", value)
+			}
+			rules = append(rules, perhostRule{
+				specs:     strings.Split(specsAndURL[0], ";"),
+				dialerURL: specsAndURL[1],
+			})
+		default:
+			return "", nil, fmt.Errorf("unsupported option %v", key)
+		}
+	}
+	if defaultURL == "" {
+		return "", nil, fmt.Errorf("perhost requires a default option")
+	}
+	return defaultURL, rules, nil
+}
+
+// applyMatchSpec parses a single "<kind>:<value>" match spec and adds dialer through the
+// add function given for that kind.
+func applyMatchSpec[T any](spec string, dialer T, addHost func(string, T), addSuffix func(string, T), addCIDR func(string, T) error, addZone func(string, T) error) error {
+	kind, value, ok := strings.Cut(spec, ":")
+	if !ok {
+		return fmt.Errorf("invalid match spec %q, must be of the form <kind>:<value>", spec)
+	}
+	switch kind {
+	case "host":
+		addHost(value, dialer)
+	case "suffix":
+		addSuffix(value, dialer)
+	case "cidr":
+		return addCIDR(value, dialer)
+	case "zone":
+		return addZone(value, dialer)
+	default:
+		return fmt.Errorf("unknown match kind %q, must be one of host, suffix, cidr, zone", kind)
+	}
+	return nil
+}
+
+// registerPerHostStreamDialer registers the "perhost:" [transport.StreamDialer] type,
+// which routes to a different child dialer depending on the destination host.
+func registerPerHostStreamDialer(r TypeRegistry[transport.StreamDialer], typeID string) {
+	r.RegisterType(typeID, func(ctx context.Context, config *Config) (transport.StreamDialer, error) {
+		defaultURL, rules, err := parsePerHostQuery(config.URL.Opaque)
+		if err != nil {
+			return nil, err
+		}
+		defDialer, err := NewStreamDialer(ctx, defaultURL)
+		if err != nil {
+			return nil, fmt.Errorf("could not create default dialer: %w", err)
+		}
+		dialer := perhost.NewStreamDialer(defDialer)
+		for _, rule := range rules {
+			child, err := NewStreamDialer(ctx, rule.dialerURL)
+			if err != nil {
+				return nil, fmt.Errorf("could not create dialer for rule %q: %w", rule.dialerURL, err)
+			}
+			for _, spec := range rule.specs {
+				if err := applyMatchSpec(spec, child, dialer.AddHost, dialer.AddDomainSuffix, dialer.AddCIDR, dialer.AddZone); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return dialer, nil
+	})
+}
+
+// registerPerHostPacketDialer registers the "perhost:" [transport.PacketDialer] type.
+// See [registerPerHostStreamDialer] for the config URL grammar.
+func registerPerHostPacketDialer(r TypeRegistry[transport.PacketDialer], typeID string) {
+	r.RegisterType(typeID, func(ctx context.Context, config *Config) (transport.PacketDialer, error) {
+		defaultURL, rules, err := parsePerHostQuery(config.URL.Opaque)
+		if err != nil {
+			return nil, err
+		}
+		defDialer, err := NewPacketDialer(ctx, defaultURL)
+		if err != nil {
+			return nil, fmt.Errorf("could not create default dialer: %w", err)
+		}
+		dialer := perhost.NewPacketDialer(defDialer)
+		for _, rule := range rules {
+			child, err := NewPacketDialer(ctx, rule.dialerURL)
+			if err != nil {
+				return nil, fmt.Errorf("could not create dialer for rule %q: %w", rule.dialerURL, err)
+			}
+			for _, spec := range rule.specs {
+				if err := applyMatchSpec(spec, child, dialer.AddHost, dialer.AddDomainSuffix, dialer.AddCIDR, dialer.AddZone); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return dialer, nil
+	})
+}
@@ -0,0 +1,70 @@
+// Copyright 2024 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configurl
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePerHostQuerySimple(t *testing.T) {
+	defaultURL, rules, err := parsePerHostQuery("default=direct&rule=cidr:10.0.0.0/8;suffix:.local;zone:loopback->socks5://gw:1080")
+	require.NoError(t, err)
+	require.Equal(t, "direct", defaultURL)
+	require.Len(t, rules, 1)
+	require.Equal(t, []string{"cidr:10.0.0.0/8", "suffix:.local", "zone:loopback"}, rules[0].specs)
+	require.Equal(t, "socks5://gw:1080", rules[0].dialerURL)
+}
+
+func TestParsePerHostQueryRoundTripsNestedAmpersandAndEquals(t *testing.T) {
+	nestedURL := "override:host=evil&port=443"
+	rawQuery := "default=direct&rule=cidr:10.0.0.0/8->" + url.QueryEscape(nestedURL)
+
+	defaultURL, rules, err := parsePerHostQuery(rawQuery)
+	require.NoError(t, err)
+	require.Equal(t, "direct", defaultURL)
+	require.Len(t, rules, 1)
+	require.Equal(t, nestedURL, rules[0].dialerURL)
+}
+
+func TestParsePerHostQueryUnescapedAmpersandSplitsTheNestedURL(t *testing.T) {
+	// Documents the sharp edge: a nested dialer URL's own "&" MUST be percent-encoded,
+	// or it's mistaken for the boundary between perhost's own options.
+	rawQuery := "default=direct&rule=cidr:10.0.0.0/8->override:host=evil&port=443"
+	_, _, err := parsePerHostQuery(rawQuery)
+	require.Error(t, err)
+}
+
+func TestParsePerHostQueryMultipleRules(t *testing.T) {
+	rawQuery := "default=direct&rule=host:a.example.com->via1&rule=host:b.example.com->via2"
+	defaultURL, rules, err := parsePerHostQuery(rawQuery)
+	require.NoError(t, err)
+	require.Equal(t, "direct", defaultURL)
+	require.Len(t, rules, 2)
+	require.Equal(t, "via1", rules[0].dialerURL)
+	require.Equal(t, "via2", rules[1].dialerURL)
+}
+
+func TestParsePerHostQueryMissingDefault(t *testing.T) {
+	_, _, err := parsePerHostQuery("rule=host:a->via1")
+	require.Error(t, err)
+}
+
+func TestParsePerHostQueryUnsupportedOption(t *testing.T) {
+	_, _, err := parsePerHostQuery("default=direct&bogus=1")
+	require.Error(t, err)
+}
@@ -0,0 +1,47 @@
+// Copyright 2024 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configurl
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/transport/socks5"
+)
+
+// registerSocks5PacketDialer registers a [transport.PacketDialer] that associates a
+// UDP session through a SOCKS5 proxy. It needs a base [transport.StreamDialer] to open
+// the control connection and a base [transport.PacketDialer] to reach the relay address
+// the proxy hands back.
+func registerSocks5PacketDialer(r TypeRegistry[transport.PacketDialer], typeID string, newSD BuildFunc[transport.StreamDialer], newPD BuildFunc[transport.PacketDialer]) {
+	r.RegisterType(typeID, func(ctx context.Context, config *Config) (transport.PacketDialer, error) {
+		sd, err := newSD(ctx, config.BaseConfig)
+		if err != nil {
+			return nil, err
+		}
+		pd, err := newPD(ctx, config.BaseConfig)
+		if err != nil {
+			return nil, err
+		}
+		endpoint := transport.StreamDialerEndpoint{Dialer: sd, Address: config.URL.Host}
+		dialer, err := socks5.NewDialer(&endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("could not create SOCKS5 dialer: %w", err)
+		}
+		dialer.EnablePacket(pd)
+		return dialer, nil
+	})
+}
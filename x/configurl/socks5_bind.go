@@ -0,0 +1,54 @@
+// Copyright 2024 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configurl
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/Jigsaw-Code/outline-sdk/transport/socks5"
+)
+
+// StreamListenerDialer creates a [transport.StreamListener] for a given destination
+// address. It is the listener-side counterpart of [transport.StreamDialer]: instead of
+// connecting out to dstAddr, it arranges for dstAddr to connect in, as SOCKS5 BIND does.
+type StreamListenerDialer interface {
+	DialStreamListener(ctx context.Context, dstAddr string) (transport.StreamListener, error)
+}
+
+type funcStreamListenerDialer func(ctx context.Context, dstAddr string) (transport.StreamListener, error)
+
+func (f funcStreamListenerDialer) DialStreamListener(ctx context.Context, dstAddr string) (transport.StreamListener, error) {
+	return f(ctx, dstAddr)
+}
+
+// registerSocks5BindStreamListenerDialer registers a [StreamListenerDialer] that
+// performs a SOCKS5 BIND against the proxy at the config URL's host for whatever
+// destination address it's given.
+func registerSocks5BindStreamListenerDialer(r TypeRegistry[StreamListenerDialer], typeID string, newSD BuildFunc[transport.StreamDialer]) {
+	r.RegisterType(typeID, func(ctx context.Context, config *Config) (StreamListenerDialer, error) {
+		sd, err := newSD(ctx, config.BaseConfig)
+		if err != nil {
+			return nil, err
+		}
+		endpoint := transport.StreamDialerEndpoint{Dialer: sd, Address: config.URL.Host}
+		dialer, err := socks5.NewDialer(&endpoint)
+		if err != nil {
+			return nil, fmt.Errorf("could not create SOCKS5 dialer: %w", err)
+		}
+		return funcStreamListenerDialer(dialer.Bind), nil
+	})
+}
@@ -0,0 +1,62 @@
+// Copyright 2024 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package netproxy adapts outline-sdk [transport.StreamDialer]s to
+// [golang.org/x/net/proxy.Dialer], and vice versa, so that the two dialer ecosystems can
+// be mixed: existing Go code written against proxy.Dialer (HTTP clients, gRPC, database
+// drivers) can be backed by an outline-sdk transport, and outline-sdk pipelines can
+// incorporate dialers from golang.org/x/net/proxy (SOCKS4a, proxy.FromEnvironment).
+package netproxy
+
+import (
+	"context"
+	"fmt"
+	"net"
+
+	"golang.org/x/net/proxy"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// Dialer adapts a [transport.StreamDialer] to [proxy.Dialer] and [proxy.ContextDialer].
+// Only the "tcp", "tcp4", and "tcp6" networks are supported, matching StreamDialer's
+// stream-oriented nature.
+type Dialer struct {
+	SD transport.StreamDialer
+}
+
+var (
+	_ proxy.Dialer        = (*Dialer)(nil)
+	_ proxy.ContextDialer = (*Dialer)(nil)
+)
+
+// NewDialer creates a [proxy.Dialer] and [proxy.ContextDialer] backed by sd.
+func NewDialer(sd transport.StreamDialer) *Dialer {
+	return &Dialer{SD: sd}
+}
+
+// Dial implements [proxy.Dialer].Dial.
+func (d *Dialer) Dial(network, addr string) (net.Conn, error) {
+	return d.DialContext(context.Background(), network, addr)
+}
+
+// DialContext implements [proxy.ContextDialer].DialContext.
+func (d *Dialer) DialContext(ctx context.Context, network, addr string) (net.Conn, error) {
+	switch network {
+	case "tcp", "tcp4", "tcp6":
+	default:
+		return nil, fmt.Errorf("netproxy: unsupported network %q, only tcp is supported", network)
+	}
+	return d.SD.DialStream(ctx, addr)
+}
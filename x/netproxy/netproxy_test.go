@@ -0,0 +1,65 @@
+// Copyright 2024 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netproxy
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDialerRejectsNonTCPNetwork(t *testing.T) {
+	d := NewDialer(transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
+		t.Fatal("should not be called")
+		return nil, nil
+	}))
+	_, err := d.Dial("udp", "example.com:53")
+	require.Error(t, err)
+}
+
+func TestDialerDialsViaStreamDialer(t *testing.T) {
+	var gotAddr string
+	d := NewDialer(transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
+		gotAddr = addr
+		return nil, nil
+	}))
+	_, err := d.Dial("tcp", "example.com:443")
+	require.NoError(t, err)
+	require.Equal(t, "example.com:443", gotAddr)
+}
+
+// fakeProxyDialer is a minimal golang.org/x/net/proxy.Dialer for tests.
+type fakeProxyDialer struct {
+	conn net.Conn
+	err  error
+}
+
+func (f *fakeProxyDialer) Dial(network, addr string) (net.Conn, error) {
+	return f.conn, f.err
+}
+
+func TestNewStreamDialerWrapsPlainConn(t *testing.T) {
+	client, server := net.Pipe()
+	t.Cleanup(func() { client.Close(); server.Close() })
+
+	sd := NewStreamDialer(&fakeProxyDialer{conn: client})
+	conn, err := sd.DialStream(context.Background(), "example.com:443")
+	require.NoError(t, err)
+	require.NoError(t, conn.CloseRead())
+	require.NoError(t, conn.CloseWrite())
+}
@@ -0,0 +1,52 @@
+// Copyright 2024 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netproxy
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+
+	"golang.org/x/net/proxy"
+
+	"github.com/Jigsaw-Code/outline-sdk/x/configurl"
+)
+
+// configURLSchemes are the outline-sdk configurl schemes registered with
+// golang.org/x/net/proxy by [RegisterConfigURLSchemes].
+var configURLSchemes = []string{"ss", "socks5", "split", "override", "tls", "perhost"}
+
+// RegisterConfigURLSchemes registers outline-sdk's configurl schemes (ss://, socks5://,
+// split:, override:, tls:, perhost:) with [proxy.RegisterDialerType], so that
+// [proxy.FromURL] transparently produces an outline-sdk-backed [proxy.Dialer] for them.
+//
+// The forward [proxy.Dialer] that [proxy.FromURL] would otherwise chain in is ignored:
+// configurl builds its dialer pipeline entirely from the URL, the same way it does when
+// used directly.
+func RegisterConfigURLSchemes() {
+	for _, scheme := range configURLSchemes {
+		proxy.RegisterDialerType(scheme, dialerTypeFunc(scheme))
+	}
+}
+
+func dialerTypeFunc(scheme string) func(*url.URL, proxy.Dialer) (proxy.Dialer, error) {
+	return func(u *url.URL, _ proxy.Dialer) (proxy.Dialer, error) {
+		sd, err := configurl.NewStreamDialer(context.Background(), u.String())
+		if err != nil {
+			return nil, fmt.Errorf("netproxy: could not create %q dialer: %w", scheme, err)
+		}
+		return NewDialer(sd), nil
+	}
+}
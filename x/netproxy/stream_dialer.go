@@ -0,0 +1,69 @@
+// Copyright 2024 The Outline Authors
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     https://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package netproxy
+
+import (
+	"context"
+	"net"
+
+	"golang.org/x/net/proxy"
+
+	"github.com/Jigsaw-Code/outline-sdk/transport"
+)
+
+// NewStreamDialer adapts pd to a [transport.StreamDialer], so that any
+// [golang.org/x/net/proxy.Dialer] (a SOCKS4a dialer, proxy.FromEnvironment, ...) can be
+// used inside an outline-sdk dialer pipeline.
+func NewStreamDialer(pd proxy.Dialer) transport.StreamDialer {
+	return transport.FuncStreamDialer(func(ctx context.Context, addr string) (transport.StreamConn, error) {
+		var conn net.Conn
+		var err error
+		if cd, ok := pd.(proxy.ContextDialer); ok {
+			conn, err = cd.DialContext(ctx, "tcp", addr)
+		} else {
+			conn, err = pd.Dial("tcp", addr)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if sc, ok := conn.(transport.StreamConn); ok {
+			return sc, nil
+		}
+		return &streamConn{Conn: conn}, nil
+	})
+}
+
+// streamConn adapts a plain [net.Conn] returned by a [proxy.Dialer] to
+// [transport.StreamConn] for dialers (like most SOCKS4a implementations) that don't
+// support half-close.
+type streamConn struct {
+	net.Conn
+}
+
+var _ transport.StreamConn = (*streamConn)(nil)
+
+func (c *streamConn) CloseRead() error {
+	if cr, ok := c.Conn.(interface{ CloseRead() error }); ok {
+		return cr.CloseRead()
+	}
+	return nil
+}
+
+func (c *streamConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}